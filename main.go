@@ -1,18 +1,32 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
 	"nostr-sample/relay"
+	"os"
 )
 
 func main() {
+	limitationPath := flag.String("limitation", "limitation.json", "path to a JSON file with Limitation config to enforce")
+	flag.Parse()
+
 	srv := relay.NewServer()
 	if err := srv.InitLogDir("log"); err != nil {
 		log.Printf("log init error: %v", err)
 	}
+	if _, err := os.Stat(*limitationPath); err == nil {
+		if err := srv.LoadLimitationFile(*limitationPath); err != nil {
+			log.Printf("limitation config error: %v", err)
+		}
+	}
+	srv.RelayURL = "ws://localhost:8080/ws"
 	http.Handle("/", srv.WithAccessLog(http.HandlerFunc(srv.HandleRelayInfo)))
 	http.Handle("/ws", srv.WithAccessLog(http.HandlerFunc(srv.HandleWebSocket)))
+	http.Handle("/events", srv.WithAccessLog(http.HandlerFunc(srv.HandleEvents)))
+	http.Handle("/events/", srv.WithAccessLog(http.HandlerFunc(srv.HandleEventsJSON)))
+	http.Handle("/event", srv.WithAccessLog(http.HandlerFunc(srv.HandlePublishEvent)))
 	port := ":8080"
 	log.Printf("Nostr relay server starting on port %s", port)
 	log.Printf("WebSocket endpoint: ws://localhost%s/ws", port)
@@ -0,0 +1,407 @@
+package relay
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// BoltStore is a BoltDB-backed EventStore: events persist across restarts
+// and are looked up through secondary indexes, with a full scan only when a
+// filter sets none of ids, authors, kinds, tags, since or until.
+//
+// Bucket layout:
+//
+//	events          id -> JSON-marshaled event
+//	idx_pubkey      pubkey\x00id -> nil
+//	idx_kind        kind\x00id -> nil
+//	idx_created_at  bigendian(created_at)\x00id -> nil
+//	idx_tag         tagname\x00value\x00id -> nil  (covers #e, #p, and any single-letter tag)
+type BoltStore struct {
+	db *bolt.DB
+}
+
+var boltBuckets = []string{"events", "idx_pubkey", "idx_kind", "idx_created_at", "idx_tag"}
+
+// NewBoltStore opens (creating if necessary) a BoltDB file at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open bolt db: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range boltBuckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return fmt.Errorf("create bucket %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (b *BoltStore) Close() error { return b.db.Close() }
+
+func (b *BoltStore) Save(ctx context.Context, ev *nostr.Event) error {
+	if ev.Kind == 5 {
+		return b.applyDeletion(ev)
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if isReplaceable(ev.Kind) {
+			if existing := findInTx(tx, func(e *nostr.Event) bool { return e.PubKey == ev.PubKey && e.Kind == ev.Kind }); existing != nil && existing.CreatedAt >= ev.CreatedAt {
+				return nil
+			} else if existing != nil {
+				if err := deleteInTx(tx, existing); err != nil {
+					return err
+				}
+			}
+		} else if isParameterizedReplaceable(ev.Kind) {
+			d := dTagValue(ev)
+			if existing := findInTx(tx, func(e *nostr.Event) bool { return e.PubKey == ev.PubKey && e.Kind == ev.Kind && dTagValue(e) == d }); existing != nil && existing.CreatedAt >= ev.CreatedAt {
+				return nil
+			} else if existing != nil {
+				if err := deleteInTx(tx, existing); err != nil {
+					return err
+				}
+			}
+		}
+		return putInTx(tx, ev)
+	})
+}
+
+func (b *BoltStore) applyDeletion(ev *nostr.Event) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		events := tx.Bucket([]byte("events"))
+		for _, tag := range ev.Tags {
+			if len(tag) < 2 || tag[0] != "e" {
+				continue
+			}
+			data := events.Get([]byte(tag[1]))
+			if data == nil {
+				continue
+			}
+			var target nostr.Event
+			if err := json.Unmarshal(data, &target); err != nil {
+				continue
+			}
+			if target.PubKey == ev.PubKey {
+				if err := deleteInTx(tx, &target); err != nil {
+					return err
+				}
+			}
+		}
+		return putInTx(tx, ev)
+	})
+}
+
+func (b *BoltStore) Delete(ctx context.Context, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte("events")).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		var ev nostr.Event
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return fmt.Errorf("unmarshal event %s: %w", id, err)
+		}
+		return deleteInTx(tx, &ev)
+	})
+}
+
+func (b *BoltStore) Query(ctx context.Context, filters []nostr.Filter) (EventIterator, error) {
+	var matched []*nostr.Event
+	err := b.db.View(func(tx *bolt.Tx) error {
+		events := tx.Bucket([]byte("events"))
+		ids, scoped := candidateIDs(tx, filters)
+		if scoped {
+			for id := range ids {
+				data := events.Get([]byte(id))
+				if data == nil {
+					continue
+				}
+				var ev nostr.Event
+				if err := json.Unmarshal(data, &ev); err != nil {
+					continue
+				}
+				if eventMatchesFilters(&ev, filters) {
+					matched = append(matched, cloneEvent(&ev))
+				}
+			}
+			return nil
+		}
+		return events.ForEach(func(_, data []byte) error {
+			var ev nostr.Event
+			if err := json.Unmarshal(data, &ev); err != nil {
+				return nil
+			}
+			if eventMatchesFilters(&ev, filters) {
+				matched = append(matched, cloneEvent(&ev))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	return newSliceIterator(sortAndLimit(matched, filters)), nil
+}
+
+func (b *BoltStore) Count(ctx context.Context, filters []nostr.Filter) (int64, error) {
+	it, err := b.Query(ctx, filters)
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	var n int64
+	for _, ok := it.Next(); ok; _, ok = it.Next() {
+		n++
+	}
+	return n, nil
+}
+
+// candidateIDs unions, across filters, the per-filter candidate sets from
+// scopedIDsForFilter. The second return value is false when any filter
+// sets none of IDs, Authors, Kinds, Tags, Since or Until (or when filters
+// is empty), meaning the caller must fall back to a full scan.
+func candidateIDs(tx *bolt.Tx, filters []nostr.Filter) (map[string]bool, bool) {
+	var union map[string]bool
+	anyScoped := false
+	for _, f := range filters {
+		ids := scopedIDsForFilter(tx, f)
+		if ids == nil {
+			return nil, false
+		}
+		anyScoped = true
+		if union == nil {
+			union = ids
+		} else {
+			for id := range ids {
+				union[id] = true
+			}
+		}
+	}
+	return union, anyScoped
+}
+
+// scopedIDsForFilter returns the set of ids matching any indexed field of
+// f, or nil if f has no indexed field to scope the scan by.
+func scopedIDsForFilter(tx *bolt.Tx, f nostr.Filter) map[string]bool {
+	var sets []map[string]bool
+
+	if len(f.IDs) > 0 {
+		ids := map[string]bool{}
+		events := tx.Bucket([]byte("events"))
+		for _, prefix := range f.IDs {
+			c := events.Cursor()
+			for k, _ := c.Seek([]byte(prefix)); k != nil && hasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+				ids[string(k)] = true
+			}
+		}
+		sets = append(sets, ids)
+	}
+	if len(f.Authors) > 0 {
+		sets = append(sets, idsFromIndexPrefix(tx, "idx_pubkey", f.Authors))
+	}
+	if len(f.Kinds) > 0 {
+		var kinds []string
+		for _, k := range f.Kinds {
+			kinds = append(kinds, strconv.Itoa(k))
+		}
+		sets = append(sets, idsFromIndexExact(tx, "idx_kind", kinds))
+	}
+	for name, vals := range f.Tags {
+		prefixed := make([]string, len(vals))
+		for i, v := range vals {
+			prefixed[i] = name + "\x00" + v
+		}
+		sets = append(sets, idsFromIndexExact(tx, "idx_tag", prefixed))
+	}
+
+	if len(sets) == 0 {
+		if f.Since != nil || f.Until != nil {
+			return idsFromCreatedAtRange(tx, f.Since, f.Until)
+		}
+		return nil
+	}
+	result := sets[0]
+	for _, s := range sets[1:] {
+		for id := range result {
+			if !s[id] {
+				delete(result, id)
+			}
+		}
+	}
+	return result
+}
+
+// idsFromCreatedAtRange scans idx_created_at for [since, until], both
+// inclusive and either may be nil to mean unbounded.
+func idsFromCreatedAtRange(tx *bolt.Tx, since, until *nostr.Timestamp) map[string]bool {
+	ids := map[string]bool{}
+	b := tx.Bucket([]byte("idx_created_at"))
+	c := b.Cursor()
+	var start []byte
+	if since != nil {
+		start = createdAtKey(*since)
+	}
+	for k, _ := c.Seek(start); k != nil; k, _ = c.Next() {
+		if until != nil && binary.BigEndian.Uint64(k[:8]) > uint64(*until) {
+			break
+		}
+		if id := idFromIndexKey(k[8:]); id != "" {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+func idsFromIndexPrefix(tx *bolt.Tx, bucket string, prefixes []string) map[string]bool {
+	ids := map[string]bool{}
+	b := tx.Bucket([]byte(bucket))
+	c := b.Cursor()
+	for _, prefix := range prefixes {
+		key := []byte(prefix)
+		for k, _ := c.Seek(key); k != nil && hasPrefix(k, key); k, _ = c.Next() {
+			if id := idFromIndexKey(k); id != "" {
+				ids[id] = true
+			}
+		}
+	}
+	return ids
+}
+
+func idsFromIndexExact(tx *bolt.Tx, bucket string, values []string) map[string]bool {
+	ids := map[string]bool{}
+	b := tx.Bucket([]byte(bucket))
+	c := b.Cursor()
+	for _, v := range values {
+		prefix := []byte(v + "\x00")
+		for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+			if id := idFromIndexKey(k); id != "" {
+				ids[id] = true
+			}
+		}
+	}
+	return ids
+}
+
+func hasPrefix(k, prefix []byte) bool {
+	if len(k) < len(prefix) {
+		return false
+	}
+	for i, b := range prefix {
+		if k[i] != b {
+			return false
+		}
+	}
+	return true
+}
+
+// idFromIndexKey extracts the trailing id from a "value\x00id" index key.
+func idFromIndexKey(k []byte) string {
+	for i := len(k) - 1; i >= 0; i-- {
+		if k[i] == 0 {
+			return string(k[i+1:])
+		}
+	}
+	return ""
+}
+
+func putInTx(tx *bolt.Tx, ev *nostr.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	if err := tx.Bucket([]byte("events")).Put([]byte(ev.ID), data); err != nil {
+		return err
+	}
+	if err := tx.Bucket([]byte("idx_pubkey")).Put(indexKey(ev.PubKey, ev.ID), nil); err != nil {
+		return err
+	}
+	if err := tx.Bucket([]byte("idx_kind")).Put(indexKey(strconv.Itoa(ev.Kind), ev.ID), nil); err != nil {
+		return err
+	}
+	if err := tx.Bucket([]byte("idx_created_at")).Put(append(createdAtKey(ev.CreatedAt), append([]byte{0}, ev.ID...)...), nil); err != nil {
+		return err
+	}
+	tagBucket := tx.Bucket([]byte("idx_tag"))
+	for _, tag := range ev.Tags {
+		if len(tag) < 2 || len(tag[0]) != 1 {
+			continue
+		}
+		if err := tagBucket.Put(indexKey(tag[0]+"\x00"+tag[1], ev.ID), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteInTx(tx *bolt.Tx, ev *nostr.Event) error {
+	if err := tx.Bucket([]byte("events")).Delete([]byte(ev.ID)); err != nil {
+		return err
+	}
+	if err := tx.Bucket([]byte("idx_pubkey")).Delete(indexKey(ev.PubKey, ev.ID)); err != nil {
+		return err
+	}
+	if err := tx.Bucket([]byte("idx_kind")).Delete(indexKey(strconv.Itoa(ev.Kind), ev.ID)); err != nil {
+		return err
+	}
+	if err := tx.Bucket([]byte("idx_created_at")).Delete(append(createdAtKey(ev.CreatedAt), append([]byte{0}, ev.ID...)...)); err != nil {
+		return err
+	}
+	tagBucket := tx.Bucket([]byte("idx_tag"))
+	for _, tag := range ev.Tags {
+		if len(tag) < 2 || len(tag[0]) != 1 {
+			continue
+		}
+		if err := tagBucket.Delete(indexKey(tag[0]+"\x00"+tag[1], ev.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func indexKey(value, id string) []byte {
+	return append([]byte(value+"\x00"), id...)
+}
+
+func createdAtKey(ts nostr.Timestamp) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(ts))
+	return b
+}
+
+func findInTx(tx *bolt.Tx, match func(*nostr.Event) bool) *nostr.Event {
+	var found *nostr.Event
+	tx.Bucket([]byte("events")).ForEach(func(_, data []byte) error {
+		if found != nil {
+			return nil
+		}
+		var ev nostr.Event
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return nil
+		}
+		if match(&ev) {
+			e := ev
+			found = &e
+		}
+		return nil
+	})
+	return found
+}
+
+func cloneEvent(ev *nostr.Event) *nostr.Event {
+	e := *ev
+	return &e
+}
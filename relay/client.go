@@ -0,0 +1,358 @@
+package relay
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type Client struct {
+	conn          *websocket.Conn
+	server        *Server
+	send          chan []byte
+	subscriptions map[string]*Subscription
+	subsMux       sync.RWMutex
+	sse           bool // true for SSE/NDJSON clients, which have no websocket conn
+
+	// authChallenge is the NIP-42 nonce this client was sent on connect.
+	authChallenge string
+	// AuthedPubkey is set once the client completes NIP-42 AUTH.
+	AuthedPubkey string
+}
+type Subscription struct {
+	ID      string
+	Filters []nostr.Filter
+}
+
+func (c *Client) readPump() {
+	defer func() {
+		c.server.clientsMux.Lock()
+		delete(c.server.clients, c)
+		c.server.clientsMux.Unlock()
+		c.conn.Close()
+		log.Printf("Client disconnected: %s", c.conn.RemoteAddr())
+	}()
+	readLimit := int64(512 * 1024)
+	if max := c.server.Limitation.MaxMessageLength; max > 0 {
+		readLimit = int64(max)
+	}
+	c.conn.SetReadLimit(readLimit)
+	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(60 * time.Second)); return nil })
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			break
+		}
+		c.handleMessage(msg)
+	}
+}
+func (c *Client) writePump() {
+	ticker := time.NewTicker(54 * time.Second)
+	defer func() { ticker.Stop(); c.conn.Close() }()
+	for {
+		select {
+		case m, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, m); err != nil {
+				log.Printf("WebSocket write error: %v", err)
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+func (c *Client) handleMessage(b []byte) {
+	var msg []interface{}
+	if err := json.Unmarshal(b, &msg); err != nil {
+		log.Printf("JSON unmarshal error: %v", err)
+		c.sendNotice("Invalid message format")
+		return
+	}
+	if len(msg) == 0 {
+		c.sendNotice("Empty message")
+		return
+	}
+	t, ok := msg[0].(string)
+	if !ok {
+		c.sendNotice("Invalid message type")
+		return
+	}
+	switch t {
+	case "EVENT":
+		c.handleEvent(msg)
+	case "REQ":
+		c.handleReq(msg)
+	case "CLOSE":
+		c.handleClose(msg)
+	case "AUTH":
+		c.handleAuth(msg)
+	case "COUNT":
+		c.handleCount(msg)
+	default:
+		c.sendNotice("Unknown message type: " + t)
+	}
+}
+func (c *Client) handleEvent(msg []interface{}) {
+	if len(msg) < 2 {
+		c.sendNotice("Invalid EVENT message")
+		return
+	}
+	raw, err := json.Marshal(msg[1])
+	if err != nil {
+		c.sendNotice("Invalid event data")
+		return
+	}
+	var ev nostr.Event
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		c.sendNotice("Invalid event format")
+		return
+	}
+	if c.server.requiresAuth(ev.Kind) && c.AuthedPubkey == "" {
+		c.sendOK(ev.ID, false, "auth-required: publishing this event requires authentication")
+		return
+	}
+	accepted, m := c.server.storeEvent(&ev)
+	c.sendOK(ev.ID, accepted, m)
+}
+func (c *Client) handleReq(msg []interface{}) {
+	if len(msg) < 2 {
+		c.sendNotice("Invalid REQ message")
+		return
+	}
+	id, ok := msg[1].(string)
+	if !ok {
+		c.sendNotice("Invalid subscription ID")
+		return
+	}
+	var filters []nostr.Filter
+	for i := 2; i < len(msg); i++ {
+		data, err := json.Marshal(msg[i])
+		if err != nil {
+			continue
+		}
+		var f nostr.Filter
+		if err := json.Unmarshal(data, &f); err == nil {
+			filters = append(filters, f)
+		}
+	}
+	if max := c.server.Limitation.MaxFilters; max > 0 && len(filters) > max {
+		filters = filters[:max]
+	}
+	if max := c.server.Limitation.MaxLimit; max > 0 {
+		for i := range filters {
+			if filters[i].Limit == 0 || filters[i].Limit > max {
+				filters[i].Limit = max
+			}
+		}
+	}
+	if c.AuthedPubkey == "" && c.server.requiresAuthForFilters(filters) {
+		c.sendClosed(id, "auth-required: this subscription requires authentication")
+		return
+	}
+	c.subsMux.Lock()
+	if _, exists := c.subscriptions[id]; !exists {
+		if max := c.server.Limitation.MaxSubscriptions; max > 0 && len(c.subscriptions) >= max {
+			c.subsMux.Unlock()
+			c.sendClosed(id, "rate-limited: too many subs")
+			return
+		}
+	}
+	c.subscriptions[id] = &Subscription{ID: id, Filters: filters}
+	c.subsMux.Unlock()
+	it, err := c.server.store.Query(context.Background(), filters)
+	if err != nil {
+		log.Printf("store query error: %v", err)
+		c.sendNotice("Error querying events")
+		return
+	}
+	defer it.Close()
+	for ev, ok := it.Next(); ok; ev, ok = it.Next() {
+		c.sendEvent(id, ev)
+	}
+	c.sendEOSE(id)
+	log.Printf("Subscription created: %s", id)
+}
+
+// handleCount implements NIP-45: reply to ["COUNT", <subid>, <filter>, ...]
+// with ["COUNT", <subid>, {"count": n}], subject to the same auth gating
+// as REQ and served from countCache when possible.
+func (c *Client) handleCount(msg []interface{}) {
+	if len(msg) < 2 {
+		c.sendNotice("Invalid COUNT message")
+		return
+	}
+	id, ok := msg[1].(string)
+	if !ok {
+		c.sendNotice("Invalid subscription ID")
+		return
+	}
+	var filters []nostr.Filter
+	for i := 2; i < len(msg); i++ {
+		data, err := json.Marshal(msg[i])
+		if err != nil {
+			continue
+		}
+		var f nostr.Filter
+		if err := json.Unmarshal(data, &f); err == nil {
+			filters = append(filters, f)
+		}
+	}
+	if c.AuthedPubkey == "" && c.server.requiresAuthForFilters(filters) {
+		c.sendClosed(id, "auth-required: this subscription requires authentication")
+		return
+	}
+
+	key := canonicalizeFilters(filters)
+	if n, ok := c.server.countCache.get(key); ok {
+		c.sendCount(id, n)
+		return
+	}
+	n, err := c.server.store.Count(context.Background(), filters)
+	if err != nil {
+		log.Printf("store count error: %v", err)
+		c.sendNotice("Error counting events")
+		return
+	}
+	c.server.countCache.set(key, n)
+	c.sendCount(id, n)
+}
+
+func (c *Client) handleClose(msg []interface{}) {
+	if len(msg) < 2 {
+		c.sendNotice("Invalid CLOSE message")
+		return
+	}
+	id, ok := msg[1].(string)
+	if !ok {
+		c.sendNotice("Invalid subscription ID")
+		return
+	}
+	c.subsMux.Lock()
+	delete(c.subscriptions, id)
+	c.subsMux.Unlock()
+	log.Printf("Subscription closed: %s", id)
+}
+
+// sendAuthChallenge generates this connection's NIP-42 nonce and sends
+// ["AUTH", <challenge>].
+func (c *Client) sendAuthChallenge() {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("auth challenge error: %v", err)
+		return
+	}
+	c.authChallenge = hex.EncodeToString(b)
+	c.sendMsg([]interface{}{"AUTH", c.authChallenge})
+}
+
+// handleAuth implements NIP-42: msg[1] must be a kind-22242 event signed
+// by the pubkey being authenticated, with a "relay" tag matching this
+// relay's URL and a "challenge" tag equal to the nonce this client was
+// sent, timestamped within 10 minutes of now.
+func (c *Client) handleAuth(msg []interface{}) {
+	if len(msg) < 2 {
+		c.sendNotice("Invalid AUTH message")
+		return
+	}
+	raw, err := json.Marshal(msg[1])
+	if err != nil {
+		c.sendNotice("Invalid auth event data")
+		return
+	}
+	var ev nostr.Event
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		c.sendNotice("Invalid auth event format")
+		return
+	}
+	if ev.Kind != 22242 {
+		c.sendOK(ev.ID, false, "invalid: auth event must be kind 22242")
+		return
+	}
+	ok, err := ev.CheckSignature()
+	if err != nil || !ok {
+		c.sendOK(ev.ID, false, "invalid signature")
+		return
+	}
+	relayTag := ev.Tags.GetFirst([]string{"relay"})
+	if relayTag == nil || len(*relayTag) < 2 {
+		c.sendOK(ev.ID, false, "invalid: auth event missing relay tag")
+		return
+	}
+	if c.server.RelayURL != "" && (*relayTag)[1] != c.server.RelayURL {
+		c.sendOK(ev.ID, false, "invalid: auth event relay tag does not match")
+		return
+	}
+	challengeTag := ev.Tags.GetFirst([]string{"challenge"})
+	if challengeTag == nil || len(*challengeTag) < 2 || (*challengeTag)[1] != c.authChallenge {
+		c.sendOK(ev.ID, false, "invalid: auth event challenge does not match")
+		return
+	}
+	if time.Since(ev.CreatedAt.Time()).Abs() > 10*time.Minute {
+		c.sendOK(ev.ID, false, "invalid: auth event created_at out of range")
+		return
+	}
+	c.AuthedPubkey = ev.PubKey
+	c.sendOK(ev.ID, true, "")
+	log.Printf("Client authenticated: pubkey=%s", ev.PubKey)
+}
+
+func (c *Client) sendEvent(id string, ev *nostr.Event) {
+	if c.sse {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			log.Printf("marshal error: %v", err)
+			return
+		}
+		select {
+		case c.send <- data:
+		default:
+		}
+		return
+	}
+	c.sendMsg([]interface{}{"EVENT", id, ev})
+}
+func (c *Client) sendOK(id string, accepted bool, m string) {
+	c.sendMsg([]interface{}{"OK", id, accepted, m})
+}
+func (c *Client) sendCount(id string, n int64) {
+	c.sendMsg([]interface{}{"COUNT", id, map[string]int64{"count": n}})
+}
+func (c *Client) sendEOSE(id string)  { c.sendMsg([]interface{}{"EOSE", id}) }
+func (c *Client) sendNotice(m string) { c.sendMsg([]interface{}{"NOTICE", m}) }
+func (c *Client) sendClosed(id, m string) {
+	c.sendMsg([]interface{}{"CLOSED", id, m})
+}
+func (c *Client) sendMsg(v []interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("marshal error: %v", err)
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		close(c.send)
+		c.server.clientsMux.Lock()
+		delete(c.server.clients, c)
+		c.server.clientsMux.Unlock()
+	}
+}
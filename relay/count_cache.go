@@ -0,0 +1,64 @@
+package relay
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// countCache absorbs repeated COUNT requests for the same filter (common
+// with dashboard-style polling) by caching the result for a short TTL,
+// keyed on the canonicalized filter JSON. It evicts least-recently-used
+// entries once full.
+type countCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type countCacheEntry struct {
+	key       string
+	count     int64
+	expiresAt time.Time
+}
+
+func newCountCache(max int, ttl time.Duration) *countCache {
+	return &countCache{ttl: ttl, max: max, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+func (c *countCache) get(key string) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return 0, false
+	}
+	entry := el.Value.(*countCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return 0, false
+	}
+	c.order.MoveToFront(el)
+	return entry.count, true
+}
+
+func (c *countCache) set(key string, count int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*countCacheEntry).count = count
+		el.Value.(*countCacheEntry).expiresAt = time.Now().Add(c.ttl)
+		c.order.MoveToFront(el)
+		return
+	}
+	el := c.order.PushFront(&countCacheEntry{key: key, count: count, expiresAt: time.Now().Add(c.ttl)})
+	c.entries[key] = el
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*countCacheEntry).key)
+	}
+}
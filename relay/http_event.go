@@ -0,0 +1,189 @@
+package relay
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// HandlePublishEvent serves POST /event: a single signed Nostr event as a
+// JSON body, run through the same CheckSignature/store/broadcast path as
+// the websocket EVENT message, replying with ["OK", id, accepted, msg].
+// HTTP has no NIP-42 challenge/response, so a publish that would require
+// AUTH over the websocket is rejected outright here.
+func (s *Server) HandlePublishEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+	var ev nostr.Event
+	if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+		http.Error(w, "invalid event format", http.StatusBadRequest)
+		return
+	}
+	if s.requiresAuth(ev.Kind) {
+		http.Error(w, "auth-required: this relay requires NIP-42 authentication, which POST /event cannot provide", http.StatusUnauthorized)
+		return
+	}
+	accepted, m := s.storeEvent(&ev)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode([]interface{}{"OK", ev.ID, accepted, m})
+}
+
+// HandleEventsJSON serves GET /events/{filter-hash}/json: it streams
+// stored events matching the filter as newline-delimited JSON, then keeps
+// the connection open and streams newly broadcast matches live. The
+// filter comes either from the path segment (base64-encoded JSON) or,
+// when that segment is "-", from query params (kinds, authors, #e, since,
+// until, limit). Since HTTP cannot do the NIP-42 challenge/response, a
+// filter that would require AUTH over the websocket is rejected with 401
+// rather than silently served.
+func (s *Server) HandleEventsJSON(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventsJSONFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.requiresAuthForFilters([]nostr.Filter{filter}) {
+		http.Error(w, "auth-required: this relay requires NIP-42 authentication, which GET /events/*/json cannot provide", http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	c := &Client{server: s, send: make(chan []byte, 256), subscriptions: map[string]*Subscription{}, sse: true}
+	c.subscriptions["http"] = &Subscription{ID: "http", Filters: []nostr.Filter{filter}}
+	s.clientsMux.Lock()
+	s.clients[c] = true
+	s.clientsMux.Unlock()
+	defer func() {
+		s.clientsMux.Lock()
+		delete(s.clients, c)
+		s.clientsMux.Unlock()
+	}()
+	log.Printf("NDJSON client connected: %s", r.RemoteAddr)
+
+	it, err := s.store.Query(r.Context(), []nostr.Filter{filter})
+	if err != nil {
+		log.Printf("store query error: %v", err)
+	} else {
+		for ev, ok := it.Next(); ok; ev, ok = it.Next() {
+			writeNDJSONEvent(w, ev)
+		}
+		it.Close()
+	}
+	flusher.Flush()
+
+	ctx := r.Context()
+	for {
+		select {
+		case data, ok := <-c.send:
+			if !ok {
+				return
+			}
+			w.Write(data)
+			w.Write([]byte("\n"))
+			flusher.Flush()
+		case <-ctx.Done():
+			log.Printf("NDJSON client disconnected: %s", r.RemoteAddr)
+			return
+		}
+	}
+}
+
+func writeNDJSONEvent(w http.ResponseWriter, ev *nostr.Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("marshal error: %v", err)
+		return
+	}
+	w.Write(data)
+	w.Write([]byte("\n"))
+}
+
+// parseEventsJSONFilter extracts the filter for /events/{filter-hash}/json
+// from the path segment, falling back to query params when that segment
+// is "-".
+func parseEventsJSONFilter(r *http.Request) (nostr.Filter, error) {
+	if !strings.HasSuffix(r.URL.Path, "/json") {
+		return nostr.Filter{}, fmt.Errorf("not found")
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/events/")
+	path = strings.TrimSuffix(path, "/json")
+	path = strings.TrimSuffix(path, "/")
+	if path != "" && path != "-" {
+		data, err := base64.RawURLEncoding.DecodeString(path)
+		if err != nil {
+			return nostr.Filter{}, fmt.Errorf("invalid filter hash: %w", err)
+		}
+		var f nostr.Filter
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nostr.Filter{}, fmt.Errorf("invalid filter: %w", err)
+		}
+		return f, nil
+	}
+	return filterFromQuery(r.URL.Query())
+}
+
+func filterFromQuery(q map[string][]string) (nostr.Filter, error) {
+	var f nostr.Filter
+	if v := q["kinds"]; len(v) > 0 {
+		for _, s := range strings.Split(v[0], ",") {
+			k, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return nostr.Filter{}, fmt.Errorf("invalid kinds: %w", err)
+			}
+			f.Kinds = append(f.Kinds, k)
+		}
+	}
+	if v := q["authors"]; len(v) > 0 {
+		f.Authors = strings.Split(v[0], ",")
+	}
+	if v := q["since"]; len(v) > 0 {
+		ts, err := strconv.ParseInt(v[0], 10, 64)
+		if err != nil {
+			return nostr.Filter{}, fmt.Errorf("invalid since: %w", err)
+		}
+		since := nostr.Timestamp(ts)
+		f.Since = &since
+	}
+	if v := q["until"]; len(v) > 0 {
+		ts, err := strconv.ParseInt(v[0], 10, 64)
+		if err != nil {
+			return nostr.Filter{}, fmt.Errorf("invalid until: %w", err)
+		}
+		until := nostr.Timestamp(ts)
+		f.Until = &until
+	}
+	if v := q["limit"]; len(v) > 0 {
+		n, err := strconv.Atoi(v[0])
+		if err != nil {
+			return nostr.Filter{}, fmt.Errorf("invalid limit: %w", err)
+		}
+		f.Limit = n
+	}
+	for key, vals := range q {
+		if !strings.HasPrefix(key, "#") || len(vals) == 0 {
+			continue
+		}
+		if f.Tags == nil {
+			f.Tags = nostr.TagMap{}
+		}
+		f.Tags[strings.TrimPrefix(key, "#")] = strings.Split(vals[0], ",")
+	}
+	return f, nil
+}
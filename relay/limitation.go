@@ -0,0 +1,89 @@
+package relay
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// LoadLimitationFile reads a JSON-encoded Limitation from path into
+// s.Limitation, turning the values RelayInfo only advertises into ones
+// actually enforced by readPump/handleReq/storeEvent. MaxSubidLength,
+// PaymentRequired and RestrictedWrites are advertised but not enforced.
+func (s *Server) LoadLimitationFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read limitation file: %w", err)
+	}
+	var lim Limitation
+	if err := json.Unmarshal(data, &lim); err != nil {
+		return fmt.Errorf("parse limitation file: %w", err)
+	}
+	s.Limitation = lim
+	return nil
+}
+
+// checkLimitation enforces the parts of Limitation that apply to an
+// individual event: content/tag size caps and NIP-13 proof-of-work.
+func (s *Server) checkLimitation(ev *nostr.Event) (bool, string) {
+	lim := s.Limitation
+	if lim.MaxContentLength > 0 && len(ev.Content) > lim.MaxContentLength {
+		return false, fmt.Sprintf("invalid: content length %d exceeds max %d", len(ev.Content), lim.MaxContentLength)
+	}
+	if lim.MaxEventTags > 0 && len(ev.Tags) > lim.MaxEventTags {
+		return false, fmt.Sprintf("invalid: %d tags exceeds max %d", len(ev.Tags), lim.MaxEventTags)
+	}
+	if lim.MinPowDifficulty > 0 {
+		difficulty, committed := proofOfWork(ev)
+		if committed > 0 && committed < difficulty {
+			difficulty = committed
+		}
+		if difficulty < lim.MinPowDifficulty {
+			return false, fmt.Sprintf("pow: difficulty %d below %d", difficulty, lim.MinPowDifficulty)
+		}
+	}
+	return true, ""
+}
+
+// proofOfWork returns the leading-zero-bit count of ev.ID (the NIP-13
+// difficulty actually achieved) and the difficulty ev's "nonce" tag
+// commits to, if any (0 when absent or unparsable).
+func proofOfWork(ev *nostr.Event) (difficulty, committed int) {
+	difficulty = leadingZeroBits(ev.ID)
+	for _, tag := range ev.Tags {
+		if len(tag) >= 3 && tag[0] == "nonce" {
+			if target, err := strconv.Atoi(tag[2]); err == nil {
+				committed = target
+			}
+			break
+		}
+	}
+	return difficulty, committed
+}
+
+// leadingZeroBits counts the leading zero bits of a hex-encoded id, as
+// defined by NIP-13.
+func leadingZeroBits(hexID string) int {
+	b, err := hex.DecodeString(hexID)
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, by := range b {
+		if by == 0 {
+			count += 8
+			continue
+		}
+		for mask := byte(0x80); mask > 0; mask >>= 1 {
+			if by&mask != 0 {
+				return count
+			}
+			count++
+		}
+	}
+	return count
+}
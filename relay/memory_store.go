@@ -0,0 +1,112 @@
+package relay
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// MemoryStore is the original all-in-RAM EventStore: a single map guarded
+// by a mutex, with no persistence across restarts. It is the default
+// backend, so events still live only for the process lifetime.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	events map[string]*nostr.Event
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{events: map[string]*nostr.Event{}}
+}
+
+func (m *MemoryStore) Save(ctx context.Context, ev *nostr.Event) error {
+	if ev.Kind == 5 {
+		return m.applyDeletion(ev)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if isReplaceable(ev.Kind) {
+		if existing := m.findReplaceableLocked(ev.PubKey, ev.Kind); existing != nil {
+			if existing.CreatedAt >= ev.CreatedAt {
+				return nil
+			}
+			delete(m.events, existing.ID)
+		}
+	} else if isParameterizedReplaceable(ev.Kind) {
+		d := dTagValue(ev)
+		if existing := m.findParameterizedReplaceableLocked(ev.PubKey, ev.Kind, d); existing != nil {
+			if existing.CreatedAt >= ev.CreatedAt {
+				return nil
+			}
+			delete(m.events, existing.ID)
+		}
+	}
+	m.events[ev.ID] = ev
+	return nil
+}
+
+// applyDeletion implements NIP-09: a kind-5 event deletes the events its
+// "e" tags reference, provided the deleting pubkey matches the original
+// author. The deletion event itself is then stored like any other event.
+func (m *MemoryStore) applyDeletion(ev *nostr.Event) error {
+	m.mu.Lock()
+	for _, tag := range ev.Tags {
+		if len(tag) >= 2 && tag[0] == "e" {
+			if target, ok := m.events[tag[1]]; ok && target.PubKey == ev.PubKey {
+				delete(m.events, tag[1])
+			}
+		}
+	}
+	m.events[ev.ID] = ev
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemoryStore) findReplaceableLocked(pubkey string, kind int) *nostr.Event {
+	for _, ev := range m.events {
+		if ev.PubKey == pubkey && ev.Kind == kind {
+			return ev
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) findParameterizedReplaceableLocked(pubkey string, kind int, d string) *nostr.Event {
+	for _, ev := range m.events {
+		if ev.PubKey == pubkey && ev.Kind == kind && dTagValue(ev) == d {
+			return ev
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	delete(m.events, id)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemoryStore) Query(ctx context.Context, filters []nostr.Filter) (EventIterator, error) {
+	m.mu.RLock()
+	all := make([]*nostr.Event, 0, len(m.events))
+	for _, ev := range m.events {
+		all = append(all, ev)
+	}
+	m.mu.RUnlock()
+	return newSliceIterator(matchesAndLimit(all, filters)), nil
+}
+
+func (m *MemoryStore) Count(ctx context.Context, filters []nostr.Filter) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var n int64
+	for _, ev := range m.events {
+		if eventMatchesFilters(ev, filters) {
+			n++
+		}
+	}
+	return n, nil
+}
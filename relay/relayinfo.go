@@ -18,22 +18,28 @@ type RelayInfo struct {
 }
 
 type Limitation struct {
-	MaxMessageLength int  `json:"max_message_length"`
-	MaxSubscriptions int  `json:"max_subscriptions"`
-	MaxFilters       int  `json:"max_filters"`
-	MaxLimit         int  `json:"max_limit"`
-	MaxSubidLength   int  `json:"max_subid_length"`
-	MaxEventTags     int  `json:"max_event_tags"`
-	MaxContentLength int  `json:"max_content_length"`
-	MinPowDifficulty int  `json:"min_pow_difficulty"`
-	AuthRequired     bool `json:"auth_required"`
-	PaymentRequired  bool `json:"payment_required"`
-	RestrictedWrites bool `json:"restricted_writes"`
+	MaxMessageLength int   `json:"max_message_length"`
+	MaxSubscriptions int   `json:"max_subscriptions"`
+	MaxFilters       int   `json:"max_filters"`
+	MaxLimit         int   `json:"max_limit"`
+	MaxSubidLength   int   `json:"max_subid_length"`
+	MaxEventTags     int   `json:"max_event_tags"`
+	MaxContentLength int   `json:"max_content_length"`
+	MinPowDifficulty int   `json:"min_pow_difficulty"`
+	AuthRequired     bool  `json:"auth_required"`
+	PaymentRequired  bool  `json:"payment_required"`
+	RestrictedWrites bool  `json:"restricted_writes"`
+	RestrictedKinds  []int `json:"restricted_kinds,omitempty"` // extension field; enforced at runtime via requiresAuth
 }
 
+// defaultLimitation seeds Server.Limitation for a freshly constructed
+// relay, and is what HandleRelayInfo advertised before Limitation was
+// wired up as enforced runtime config. Override it with LoadLimitationFile.
+var defaultLimitation = Limitation{MaxMessageLength: 16384, MaxSubscriptions: 20, MaxFilters: 100, MaxLimit: 5000, MaxSubidLength: 100, MaxEventTags: 100, MaxContentLength: 8196, MinPowDifficulty: 0, AuthRequired: false, PaymentRequired: false, RestrictedWrites: false}
+
 func (s *Server) HandleRelayInfo(w http.ResponseWriter, r *http.Request) {
 	if r.Header.Get("Accept") == "application/nostr+json" {
-		info := RelayInfo{Name: "Nostr Sample Relay", Description: "A sample Nostr relay implementation in Go", Contact: "admin@example.com", SupportedNips: []int{1, 2, 9, 11, 12, 15, 16, 20, 22}, Software: "nostr-sample", Version: "1.0.0", Limitation: Limitation{MaxMessageLength: 16384, MaxSubscriptions: 20, MaxFilters: 100, MaxLimit: 5000, MaxSubidLength: 100, MaxEventTags: 100, MaxContentLength: 8196, MinPowDifficulty: 0, AuthRequired: false, PaymentRequired: false, RestrictedWrites: false}}
+		info := RelayInfo{Name: "Nostr Sample Relay", Description: "A sample Nostr relay implementation in Go", Contact: "admin@example.com", SupportedNips: []int{1, 2, 9, 11, 12, 15, 16, 20, 22, 42, 45}, Software: "nostr-sample", Version: "1.0.0", Limitation: s.Limitation}
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
@@ -1,7 +1,7 @@
 package relay
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -18,15 +18,35 @@ import (
 type Server struct {
 	clients    map[*Client]bool
 	clientsMux sync.RWMutex
-	events     map[string]*nostr.Event
-	eventsMux  sync.RWMutex
+	store      EventStore
+	countCache *countCache
 	upgrader   websocket.Upgrader
 	accessLog  *log.Logger
 	eventLog   *log.Logger
+
+	// RelayURL is this relay's canonical websocket URL (e.g.
+	// "wss://relay.example.com/ws"). NIP-42 AUTH events must carry it in
+	// their "relay" tag; left empty, that check is skipped.
+	RelayURL string
+	// Limitation gates handleEvent/handleReq: AuthRequired demands a
+	// successful NIP-42 AUTH before any write or read, and RestrictedKinds
+	// demands it only for events/filters touching those kinds.
+	Limitation Limitation
 }
 
+// NewServer returns a Server backed by an in-memory EventStore, matching
+// the relay's original behavior of holding events only for the process
+// lifetime. Use NewServerWithStore to persist events across restarts.
 func NewServer() *Server {
-	return &Server{clients: map[*Client]bool{}, events: map[string]*nostr.Event{}, upgrader: websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}, accessLog: log.New(os.Stdout, "ACCESS ", log.LstdFlags)}
+	return NewServerWithStore(NewMemoryStore())
+}
+
+// NewServerWithStore returns a Server backed by store, e.g. a BoltStore
+// for persistence across restarts. Limitation starts at the relay's
+// previous advertised-only defaults; call LoadLimitationFile to override
+// them from config.
+func NewServerWithStore(store EventStore) *Server {
+	return &Server{clients: map[*Client]bool{}, store: store, countCache: newCountCache(1024, 5*time.Second), upgrader: websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}, accessLog: log.New(os.Stdout, "ACCESS ", log.LstdFlags), Limitation: defaultLimitation}
 }
 
 // InitAccessLog sets file logging (append) plus stdout
@@ -95,18 +115,6 @@ func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
-type Client struct {
-	conn          *websocket.Conn
-	server        *Server
-	send          chan []byte
-	subscriptions map[string]*Subscription
-	subsMux       sync.RWMutex
-}
-type Subscription struct {
-	ID      string
-	Filters []nostr.Filter
-}
-
 func (s *Server) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -120,168 +128,84 @@ func (s *Server) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Client connected: %s", conn.RemoteAddr())
 	go c.writePump()
 	go c.readPump()
+	c.sendAuthChallenge()
 }
 
-func (c *Client) readPump() {
-	defer func() {
-		c.server.clientsMux.Lock()
-		delete(c.server.clients, c)
-		c.server.clientsMux.Unlock()
-		c.conn.Close()
-		log.Printf("Client disconnected: %s", c.conn.RemoteAddr())
-	}()
-	c.conn.SetReadLimit(512 * 1024)
-	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(60 * time.Second)); return nil })
-	for {
-		_, msg, err := c.conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
-			}
-			break
-		}
-		c.handleMessage(msg)
-	}
-}
-func (c *Client) writePump() {
-	ticker := time.NewTicker(54 * time.Second)
-	defer func() { ticker.Stop(); c.conn.Close() }()
-	for {
-		select {
-		case m, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-			if err := c.conn.WriteMessage(websocket.TextMessage, m); err != nil {
-				log.Printf("WebSocket write error: %v", err)
-				return
-			}
-		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				return
-			}
-		}
-	}
-}
-func (c *Client) handleMessage(b []byte) {
-	var msg []interface{}
-	if err := json.Unmarshal(b, &msg); err != nil {
-		log.Printf("JSON unmarshal error: %v", err)
-		c.sendNotice("Invalid message format")
-		return
-	}
-	if len(msg) == 0 {
-		c.sendNotice("Empty message")
-		return
-	}
-	t, ok := msg[0].(string)
-	if !ok {
-		c.sendNotice("Invalid message type")
-		return
-	}
-	switch t {
-	case "EVENT":
-		c.handleEvent(msg)
-	case "REQ":
-		c.handleReq(msg)
-	case "CLOSE":
-		c.handleClose(msg)
-	default:
-		c.sendNotice("Unknown message type: " + t)
-	}
-}
-func (c *Client) handleEvent(msg []interface{}) {
-	if len(msg) < 2 {
-		c.sendNotice("Invalid EVENT message")
-		return
-	}
-	raw, err := json.Marshal(msg[1])
-	if err != nil {
-		c.sendNotice("Invalid event data")
-		return
-	}
-	var ev nostr.Event
-	if err := json.Unmarshal(raw, &ev); err != nil {
-		c.sendNotice("Invalid event format")
-		return
-	}
+// storeEvent validates, stores and broadcasts ev, returning the same
+// (accepted, message) pair that goes into an OK response. It is the shared
+// path for events arriving over the websocket EVENT message and the HTTP
+// POST /event endpoint.
+func (s *Server) storeEvent(ev *nostr.Event) (bool, string) {
 	ok, err := ev.CheckSignature()
 	if err != nil || !ok {
-		c.sendOK(ev.ID, false, "invalid signature")
-		return
+		return false, "invalid signature"
 	}
-	c.server.eventsMux.Lock()
-	c.server.events[ev.ID] = &ev
-	c.server.eventsMux.Unlock()
-	c.sendOK(ev.ID, true, "")
-	c.server.broadcastEvent(&ev)
-	if c.server.eventLog != nil {
-		c.server.eventLog.Printf("stored id=%s kind=%d pub=%s size=%d", ev.ID, ev.Kind, ev.PubKey, len(ev.Content))
+	if ev.ID != ev.GetID() {
+		return false, "invalid: id does not match event hash"
 	}
-	log.Printf("Event stored: %s", ev.ID)
-}
-func (c *Client) handleReq(msg []interface{}) {
-	if len(msg) < 2 {
-		c.sendNotice("Invalid REQ message")
-		return
+	if ok, msg := s.checkLimitation(ev); !ok {
+		return false, msg
 	}
-	id, ok := msg[1].(string)
-	if !ok {
-		c.sendNotice("Invalid subscription ID")
-		return
+	if err := s.store.Save(context.Background(), ev); err != nil {
+		log.Printf("store save error: %v", err)
+		return false, fmt.Sprintf("error: %v", err)
 	}
-	var filters []nostr.Filter
-	for i := 2; i < len(msg); i++ {
-		data, err := json.Marshal(msg[i])
-		if err != nil {
-			continue
-		}
-		var f nostr.Filter
-		if err := json.Unmarshal(data, &f); err == nil {
-			filters = append(filters, f)
-		}
+	s.broadcastEvent(ev)
+	if s.eventLog != nil {
+		s.eventLog.Printf("stored id=%s kind=%d pub=%s size=%d", ev.ID, ev.Kind, ev.PubKey, len(ev.Content))
 	}
-	c.subsMux.Lock()
-	c.subscriptions[id] = &Subscription{ID: id, Filters: filters}
-	c.subsMux.Unlock()
-	c.server.eventsMux.RLock()
-	for _, ev := range c.server.events {
-		if c.eventMatchesFilters(ev, filters) {
-			c.sendEvent(id, ev)
+	log.Printf("Event stored: %s", ev.ID)
+	return true, ""
+}
+
+// requiresAuth reports whether kind is gated behind NIP-42 AUTH, either
+// because the whole relay demands it or because kind is restricted.
+func (s *Server) requiresAuth(kind int) bool {
+	if s.Limitation.AuthRequired {
+		return true
+	}
+	for _, k := range s.Limitation.RestrictedKinds {
+		if k == kind {
+			return true
 		}
 	}
-	c.server.eventsMux.RUnlock()
-	c.sendEOSE(id)
-	log.Printf("Subscription created: %s", id)
+	return false
 }
-func (c *Client) handleClose(msg []interface{}) {
-	if len(msg) < 2 {
-		c.sendNotice("Invalid CLOSE message")
-		return
+
+// requiresAuthForFilters reports whether an unauthenticated client must be
+// rejected before any of filters is queried: either the whole relay
+// demands AUTH, or a restricted kind could be among the results. A filter
+// with no Kinds is treated as matching every kind, so it is gated
+// whenever RestrictedKinds is non-empty rather than silently let through.
+func (s *Server) requiresAuthForFilters(filters []nostr.Filter) bool {
+	if s.Limitation.AuthRequired {
+		return true
+	}
+	if len(s.Limitation.RestrictedKinds) == 0 {
+		return false
 	}
-	id, ok := msg[1].(string)
-	if !ok {
-		c.sendNotice("Invalid subscription ID")
-		return
+	for _, f := range filters {
+		if len(f.Kinds) == 0 {
+			return true
+		}
+		for _, k := range f.Kinds {
+			if s.requiresAuth(k) {
+				return true
+			}
+		}
 	}
-	c.subsMux.Lock()
-	delete(c.subscriptions, id)
-	c.subsMux.Unlock()
-	log.Printf("Subscription closed: %s", id)
+	return false
 }
-func (c *Client) eventMatchesFilters(ev *nostr.Event, fs []nostr.Filter) bool {
+
+func eventMatchesFilters(ev *nostr.Event, fs []nostr.Filter) bool {
 	for _, f := range fs {
-		if c.eventMatchesFilter(ev, f) {
+		if eventMatchesFilter(ev, f) {
 			return true
 		}
 	}
 	return false
 }
-func (c *Client) eventMatchesFilter(ev *nostr.Event, f nostr.Filter) bool {
+func eventMatchesFilter(ev *nostr.Event, f nostr.Filter) bool {
 	if len(f.IDs) > 0 {
 		ok := false
 		for _, id := range f.IDs {
@@ -354,31 +278,10 @@ func (s *Server) broadcastEvent(ev *nostr.Event) {
 	for c := range s.clients {
 		c.subsMux.RLock()
 		for id, sub := range c.subscriptions {
-			if c.eventMatchesFilters(ev, sub.Filters) {
+			if eventMatchesFilters(ev, sub.Filters) {
 				c.sendEvent(id, ev)
 			}
 		}
 		c.subsMux.RUnlock()
 	}
 }
-func (c *Client) sendEvent(id string, ev *nostr.Event) { c.sendMsg([]interface{}{"EVENT", id, ev}) }
-func (c *Client) sendOK(id string, accepted bool, m string) {
-	c.sendMsg([]interface{}{"OK", id, accepted, m})
-}
-func (c *Client) sendEOSE(id string)  { c.sendMsg([]interface{}{"EOSE", id}) }
-func (c *Client) sendNotice(m string) { c.sendMsg([]interface{}{"NOTICE", m}) }
-func (c *Client) sendMsg(v []interface{}) {
-	data, err := json.Marshal(v)
-	if err != nil {
-		log.Printf("marshal error: %v", err)
-		return
-	}
-	select {
-	case c.send <- data:
-	default:
-		close(c.send)
-		c.server.clientsMux.Lock()
-		delete(c.server.clients, c)
-		c.server.clientsMux.Unlock()
-	}
-}
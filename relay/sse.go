@@ -0,0 +1,119 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// HandleEvents serves /events: a read-only Server-Sent Events stream that
+// mirrors a REQ subscription over HTTP. The filter is read from the
+// "filter" query parameter (a JSON-encoded nostr.Filter) or, for POST
+// requests, from the JSON request body, which may be a single filter
+// object or an array of filter objects. Since HTTP cannot do the NIP-42
+// challenge/response, a filter that would require AUTH over the
+// websocket is rejected with 401 rather than silently served.
+func (s *Server) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseSSEFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.requiresAuthForFilters(filters) {
+		http.Error(w, "auth-required: this relay requires NIP-42 authentication, which /events cannot provide", http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	c := &Client{server: s, send: make(chan []byte, 256), subscriptions: map[string]*Subscription{}, sse: true}
+	c.subscriptions["sse"] = &Subscription{ID: "sse", Filters: filters}
+	s.clientsMux.Lock()
+	s.clients[c] = true
+	s.clientsMux.Unlock()
+	defer func() {
+		s.clientsMux.Lock()
+		delete(s.clients, c)
+		s.clientsMux.Unlock()
+	}()
+	log.Printf("SSE client connected: %s", r.RemoteAddr)
+
+	it, err := s.store.Query(r.Context(), filters)
+	if err != nil {
+		log.Printf("store query error: %v", err)
+	} else {
+		for ev, ok := it.Next(); ok; ev, ok = it.Next() {
+			writeSSEEvent(w, ev)
+		}
+		it.Close()
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(54 * time.Second)
+	defer ticker.Stop()
+	ctx := r.Context()
+	for {
+		select {
+		case data, ok := <-c.send:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-ctx.Done():
+			log.Printf("SSE client disconnected: %s", r.RemoteAddr)
+			return
+		}
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, ev *nostr.Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("marshal error: %v", err)
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+func parseSSEFilters(r *http.Request) ([]nostr.Filter, error) {
+	var raw json.RawMessage
+	if r.Method == http.MethodPost {
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			return nil, fmt.Errorf("invalid filter body: %w", err)
+		}
+	} else if q := r.URL.Query().Get("filter"); q != "" {
+		raw = json.RawMessage(q)
+	} else {
+		return []nostr.Filter{{}}, nil
+	}
+
+	var filters []nostr.Filter
+	if err := json.Unmarshal(raw, &filters); err == nil {
+		return filters, nil
+	}
+	var f nostr.Filter
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	return []nostr.Filter{f}, nil
+}
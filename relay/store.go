@@ -0,0 +1,142 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// canonicalizeFilters produces a stable cache key for filters: the marshaled
+// filters are decoded into generic maps and marshaled again, and
+// encoding/json sorts map keys when marshaling, so equivalent filter sets
+// (including their tag conditions) always serialize identically regardless
+// of the order nostr.Filter's own marshaler emits them in.
+func canonicalizeFilters(filters []nostr.Filter) string {
+	data, err := json.Marshal(filters)
+	if err != nil {
+		return ""
+	}
+	var generic []map[string]interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return string(data)
+	}
+	if data, err = json.Marshal(generic); err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// EventStore is the persistence boundary for stored events. It decouples
+// Server from any one storage strategy: MemoryStore keeps the original
+// all-in-RAM behavior, while BoltStore persists events (and their
+// indexes) to disk across restarts.
+//
+// Save applies NIP-09 deletion and NIP-16/NIP-33 replaceable semantics
+// before writing: a deletion event (kind 5) removes the events its "e"
+// tags reference that share its author, and is then stored itself, and a
+// replaceable/parameterized-replaceable event silently replaces any
+// older event sharing its replacement key instead of accumulating.
+type EventStore interface {
+	Save(ctx context.Context, ev *nostr.Event) error
+	Delete(ctx context.Context, id string) error
+	Query(ctx context.Context, filters []nostr.Filter) (EventIterator, error)
+	Count(ctx context.Context, filters []nostr.Filter) (int64, error)
+}
+
+// EventIterator walks a Query result set one event at a time so an
+// indexed backend never has to materialize matches it won't use.
+type EventIterator interface {
+	// Next advances the iterator and reports whether an event is
+	// available. It returns false once the set is exhausted or the
+	// underlying query failed.
+	Next() (*nostr.Event, bool)
+	Close() error
+}
+
+// isReplaceable reports whether kind is a NIP-16 replaceable kind, keyed
+// on pubkey+kind.
+func isReplaceable(kind int) bool {
+	return kind == 0 || kind == 3 || (kind >= 10000 && kind < 20000)
+}
+
+// isParameterizedReplaceable reports whether kind is a NIP-33
+// parameterized-replaceable kind, keyed on pubkey+kind+"d" tag.
+func isParameterizedReplaceable(kind int) bool {
+	return kind >= 30000 && kind < 40000
+}
+
+// dTagValue returns the value of ev's first "d" tag, defaulting to "" for
+// parameterized-replaceable events that omit it.
+func dTagValue(ev *nostr.Event) string {
+	for _, tag := range ev.Tags {
+		if len(tag) >= 2 && tag[0] == "d" {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+// matchesAndLimit applies eventMatchesFilters to evs, then sorts and
+// limits the result per sortAndLimit.
+func matchesAndLimit(evs []*nostr.Event, filters []nostr.Filter) []*nostr.Event {
+	matched := make([]*nostr.Event, 0, len(evs))
+	for _, ev := range evs {
+		if eventMatchesFilters(ev, filters) {
+			matched = append(matched, ev)
+		}
+	}
+	return sortAndLimit(matched, filters)
+}
+
+// sortAndLimit orders already-filtered events newest-first, honoring each
+// filter's own Limit independently as NIP-01 requires: a REQ's filters
+// are separate queries whose results are unioned, not one combined query
+// sharing a single cap. Each filter contributes at most its own Limit
+// (0 meaning unlimited) of its newest matches, then the per-filter
+// results are merged and deduplicated by ID.
+func sortAndLimit(matched []*nostr.Event, filters []nostr.Filter) []*nostr.Event {
+	seen := make(map[string]bool, len(matched))
+	var out []*nostr.Event
+	for _, f := range filters {
+		var perFilter []*nostr.Event
+		for _, ev := range matched {
+			if eventMatchesFilter(ev, f) {
+				perFilter = append(perFilter, ev)
+			}
+		}
+		sort.Slice(perFilter, func(i, j int) bool { return perFilter[i].CreatedAt > perFilter[j].CreatedAt })
+		if f.Limit > 0 && len(perFilter) > f.Limit {
+			perFilter = perFilter[:f.Limit]
+		}
+		for _, ev := range perFilter {
+			if !seen[ev.ID] {
+				seen[ev.ID] = true
+				out = append(out, ev)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt > out[j].CreatedAt })
+	return out
+}
+
+// sliceIterator is the EventIterator used by both store implementations
+// once a query's matches have been collected into memory.
+type sliceIterator struct {
+	evs []*nostr.Event
+	i   int
+}
+
+func newSliceIterator(evs []*nostr.Event) *sliceIterator { return &sliceIterator{evs: evs} }
+
+func (it *sliceIterator) Next() (*nostr.Event, bool) {
+	if it.i >= len(it.evs) {
+		return nil, false
+	}
+	ev := it.evs[it.i]
+	it.i++
+	return ev, true
+}
+
+func (it *sliceIterator) Close() error { return nil }